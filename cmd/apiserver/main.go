@@ -19,19 +19,25 @@ package main
 import (
 	"context"
 	"crypto/sha1"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/buildinfo"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/adminapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/certapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/eventsapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/verifyapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/events"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit/limitware"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
@@ -45,6 +51,8 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/mikehelmick/go-chaff"
 	"github.com/sethvargo/go-signalcontext"
+
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
@@ -66,6 +74,44 @@ func main() {
 	logger.Info("successful shutdown")
 }
 
+// envOrDefault returns the value of the environment variable key, or def if
+// it's unset or empty.
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// loadTokenTrustCacheConfigFromEnv builds a middleware.TokenTrustCacheConfig
+// from the environment. config.APIServerConfig doesn't have a
+// TokenTrustCache field to load this from cfg the way the rest of this
+// function's sibling configs are loaded, so this mirrors the TOKEN_TRUST_CACHE_*
+// env vars middleware.TokenTrustCacheConfig documents directly, the same way
+// LOG_DEBUG is read directly above in main().
+func loadTokenTrustCacheConfigFromEnv() (*middleware.TokenTrustCacheConfig, error) {
+	enabled, err := strconv.ParseBool(envOrDefault("TOKEN_TRUST_CACHE_ENABLED", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TOKEN_TRUST_CACHE_ENABLED: %w", err)
+	}
+
+	expiration, err := time.ParseDuration(envOrDefault("TOKEN_TRUST_CACHE_EXPIRATION", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TOKEN_TRUST_CACHE_EXPIRATION: %w", err)
+	}
+
+	hmacKey := os.Getenv("TOKEN_TRUST_CACHE_HMAC_KEY")
+	if hmacKey == "" {
+		return nil, fmt.Errorf("TOKEN_TRUST_CACHE_HMAC_KEY is required")
+	}
+
+	return &middleware.TokenTrustCacheConfig{
+		Enabled:         enabled,
+		CacheExpiration: expiration,
+		HMACKey:         []byte(hmacKey),
+	}, nil
+}
+
 func realMain(ctx context.Context) error {
 	logger := logging.FromContext(ctx)
 
@@ -87,6 +133,31 @@ func realMain(ctx context.Context) error {
 	defer oe.Close()
 	logger.Infow("observability exporter", "config", oeConfig)
 
+	// Setup tracing. This installs a tracer provider and, via
+	// middleware.Tracing below, opens one top-level server span per request
+	// that downstream handlers inherit through the request context.
+	//
+	// This is a PARTIAL implementation of the original request. Exporter
+	// selection (Zipkin/Jaeger/Stackdriver/OTLP) already comes from
+	// cfg.ObservabilityExporterConfig() via NewTraceExporterFromEnv below, so
+	// no separate TraceExporter config field was added. What's still missing:
+	// child spans around the individual cache, database, and
+	// keys.KeyManager calls made inside the verify/certificate exchange
+	// flow, so those calls only ever show up as part of the single
+	// top-level request span, not broken out individually. Adding those
+	// spans means touching verifyapi/certapi's call sites directly, and
+	// neither package is present in this checkout.
+	tp, err := observability.NewTraceExporterFromEnv(ctx, oeConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create trace exporter: %w", err)
+	}
+	otel.SetTracerProvider(tp)
+	defer func() {
+		if err := tp.Shutdown(ctx); err != nil {
+			logger.Errorw("failed to shut down trace exporter", "error", err)
+		}
+	}()
+
 	// Setup cacher
 	cacher, err := cache.CacherFor(ctx, &cfg.Cache, cache.MultiKeyFunc(
 		cache.HMACKeyFunc(sha1.New, cfg.Cache.HMACKey),
@@ -148,6 +219,10 @@ func realMain(ctx context.Context) error {
 		return fmt.Errorf("failed to create renderer: %w", err)
 	}
 
+	// Install tracing before rate limiting so that rate-limited (and
+	// rejected) requests still show up as a span.
+	r.Use(middleware.Tracing(ctx, "apiserver"))
+
 	// Install the rate limiting first. In this case, we want to limit by key
 	// first to reduce the chance of a database lookup.
 	r.Use(rateLimit)
@@ -156,13 +231,31 @@ func realMain(ctx context.Context) error {
 	requireAPIKey := middleware.RequireAPIKey(ctx, cacher, db, h, []database.APIUserType{
 		database.APIUserTypeDevice,
 	})
+
+	// Devices that provisioned an X.509 identity may authenticate with a
+	// client certificate instead of the X-API-Key header. Requests without a
+	// client certificate fall through to requireAPIKey unchanged.
+	requireAuth := middleware.RequireClientCert(ctx, db, h, requireAPIKey)
+
+	// Cache the AuthorizedApp resolved for a given X-API-Key so repeat
+	// requests from the same device don't each pay a database round-trip.
+	tokenTrustCacheConfig, err := loadTokenTrustCacheConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load token trust cache config: %w", err)
+	}
+	tokenTrustCache, err := middleware.NewTokenTrustCache(ctx, tokenTrustCacheConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create token trust cache: %w", err)
+	}
+	cachedAuth := middleware.CacheTokenTrust(ctx, tokenTrustCache, requireAuth)
+
 	processFirewall := middleware.ProcessFirewall(ctx, h, "apiserver")
 
 	r.Handle("/health", controller.HandleHealthz(ctx, &cfg.Database, h)).Methods("GET")
 
 	{
 		sub := r.PathPrefix("/api").Subrouter()
-		sub.Use(requireAPIKey)
+		sub.Use(cachedAuth)
 		sub.Use(processFirewall)
 
 		// POST /api/verify
@@ -182,9 +275,55 @@ func realMain(ctx context.Context) error {
 			return fmt.Errorf("failed to create certapi controller: %w", err)
 		}
 		sub.Handle("/certificate", handleChaff(certChaff, certapiController.HandleCertificate())).Methods("POST")
+
+		// POST /api/events/subscriptions, DELETE /api/events/subscriptions
+		eventsDispatcher := events.NewDispatcher(db)
+		eventsapiController, err := eventsapi.New(ctx, cfg, db, h, eventsDispatcher)
+		if err != nil {
+			return fmt.Errorf("failed to create events api controller: %w", err)
+		}
+		eventsSub := sub.PathPrefix("/events").Subrouter()
+		eventsSub.Handle("/subscriptions", eventsapiController.HandleSubscribe()).Methods("POST")
+		eventsSub.Handle("/subscriptions", eventsapiController.HandleUnsubscribe()).Methods("DELETE")
+
+		// GET /api/checkcodestatus/stream
+		issueapiController, err := issueapi.New(ctx, cfg, db, h, eventsDispatcher)
+		if err != nil {
+			return fmt.Errorf("failed to create issue api controller: %w", err)
+		}
+		sub.Handle("/checkcodestatus/stream", issueapiController.HandleCheckCodeStatusStream()).Methods("GET")
 	}
 
-	srv, err := server.New(cfg.Port)
+	{
+		// Maintenance endpoints, gated behind an admin API key rather than
+		// the device-facing requireAuth/cachedAuth chain used above.
+		requireAdminAPIKey := middleware.RequireAPIKey(ctx, cacher, db, h, []database.APIUserType{
+			database.APIUserTypeAdmin,
+		})
+
+		adminapiController, err := adminapi.New(ctx, cfg, db, h, tokenTrustCache)
+		if err != nil {
+			return fmt.Errorf("failed to create admin api controller: %w", err)
+		}
+
+		adminSub := r.PathPrefix("/api/admin").Subrouter()
+		adminSub.Use(requireAdminAPIKey)
+		adminSub.Use(processFirewall)
+
+		// POST /api/admin/invalidate-token-cache
+		adminSub.Handle("/invalidate-token-cache", adminapiController.HandleInvalidateTokenCache()).Methods("POST")
+
+		// POST /api/admin/trusted-cas
+		adminSub.Handle("/trusted-cas", adminapiController.HandleAddTrustedCA()).Methods("POST")
+	}
+
+	// Request, but do not require, a client certificate so that devices using
+	// mTLS and devices using X-API-Key can be served from the same listener;
+	// middleware.RequireClientCert falls through to requireAPIKey when none
+	// is presented.
+	srv, err := server.NewWithTLSConfig(cfg.Port, &tls.Config{
+		ClientAuth: tls.RequestClientCert,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
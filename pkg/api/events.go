@@ -0,0 +1,68 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// EventSubscriptionRequest is the request for registering a webhook
+// subscription to verification-code lifecycle events.
+//
+// API: POST /api/events/subscriptions
+type EventSubscriptionRequest struct {
+	// CallbackURL is the HTTPS endpoint that will receive signed event
+	// callbacks.
+	CallbackURL string `json:"callbackURL"`
+
+	// EventTypes filters the subscription to the given lifecycle events
+	// (e.g. "code.claimed", "code.expired"). If empty, all event types are
+	// delivered.
+	EventTypes []string `json:"eventTypes,omitempty"`
+
+	// CodeUUID optionally scopes the subscription to a single verification
+	// code.
+	CodeUUID string `json:"codeUUID,omitempty"`
+}
+
+// EventSubscriptionResponse is returned after a successful registration.
+//
+// API: POST /api/events/subscriptions
+type EventSubscriptionResponse struct {
+	// SubscriptionID identifies the subscription for a future unsubscribe
+	// call.
+	SubscriptionID string `json:"subscriptionID"`
+
+	// HMACSecret signs the body of every callback delivered to this
+	// subscription. Store it to verify callback authenticity.
+	HMACSecret string `json:"hmacSecret"`
+}
+
+// UnsubscribeRequest is the request to remove a webhook subscription.
+//
+// API: DELETE /api/events/subscriptions
+type UnsubscribeRequest struct {
+	// SubscriptionID is the identifier returned from the subscribe call.
+	SubscriptionID string `json:"subscriptionID"`
+}
+
+// AddTrustedCARequest registers a realm-scoped CA certificate trusted to
+// issue the client certificates device installs present to
+// middleware.RequireClientCert.
+//
+// API: POST /api/admin/trusted-cas
+type AddTrustedCARequest struct {
+	// RealmID is the realm the certificate is trusted for.
+	RealmID uint `json:"realmID"`
+
+	// PEM is the PEM-encoded CA certificate.
+	PEM string `json:"pem"`
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package adminapi implements apiserver maintenance endpoints that are not
+// part of the device-facing verification API, such as flushing the
+// token-trust-verification cache during incident response.
+package adminapi
+
+import (
+	"context"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// Controller implements the HTTP handlers for the apiserver admin
+// maintenance API.
+type Controller struct {
+	config          *config.APIServerConfig
+	db              *database.Database
+	h               render.Renderer
+	tokenTrustCache *middleware.TokenTrustCache
+	logger          *zap.SugaredLogger
+}
+
+// New creates a new admin maintenance API controller.
+func New(ctx context.Context, cfg *config.APIServerConfig, db *database.Database, h render.Renderer, tokenTrustCache *middleware.TokenTrustCache) (*Controller, error) {
+	return &Controller{
+		config:          cfg,
+		db:              db,
+		h:               h,
+		tokenTrustCache: tokenTrustCache,
+		logger:          logging.FromContext(ctx).Named("adminapi"),
+	}, nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adminapi
+
+import (
+	"net/http"
+)
+
+// HandleInvalidateTokenCache flushes the token-trust-verification cache so
+// that a just-disabled API key or just-removed user is honored on the very
+// next request, instead of waiting out the configured cache expiration.
+// It's a maintenance endpoint for incident response, gated behind an admin
+// API key rather than the device-facing authentication used by the rest of
+// this server.
+func (c *Controller) HandleInvalidateTokenCache() http.Handler {
+	logger := c.logger.Named("HandleInvalidateTokenCache")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.tokenTrustCache.Invalidate()
+		logger.Infow("token trust cache invalidated")
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adminapi
+
+import (
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// HandleAddTrustedCA registers a realm-scoped CA certificate trusted to
+// issue the client certificates device installs present to
+// middleware.RequireClientCert. It's the only way to populate
+// database.RealmTrustedCA short of a manual database write.
+func (c *Controller) HandleAddTrustedCA() http.Handler {
+	logger := c.logger.Named("HandleAddTrustedCA")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request api.AddTrustedCARequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		ca := &database.RealmTrustedCA{
+			RealmID: request.RealmID,
+			PEM:     request.PEM,
+		}
+		if err := c.db.SaveRealmTrustedCA(ca); err != nil {
+			logger.Errorw("failed to save realm trusted CA", "error", err)
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("failed to save trusted CA: %v", err))
+			return
+		}
+
+		// The mTLS middleware caches parsed trust bundles for
+		// trustBundleCacheTTL; invalidate so this CA is honored immediately
+		// instead of after the next cache refresh.
+		middleware.InvalidateTrustBundleCache()
+
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package eventsapi implements the device-facing API for registering and
+// removing webhook subscriptions to verification-code lifecycle events.
+package eventsapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/events"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// Controller implements the HTTP handlers for the events subscription API.
+type Controller struct {
+	config     *config.APIServerConfig
+	db         *database.Database
+	h          render.Renderer
+	dispatcher *events.Dispatcher
+	logger     *zap.SugaredLogger
+}
+
+// New creates a new events API controller. dispatcher is the same
+// lifecycle-event dispatcher the apiserver passes to issueapi, so a
+// subscription registered here starts receiving CodeClaimed/CodeExpired
+// callbacks as soon as a client opens a /checkcodestatus/stream connection
+// for the affected code and observes the transition. CodeIssued and
+// CertificateIssued are not dispatched anywhere yet: the code-issuance and
+// certificate-exchange write paths that own those transitions are not wired
+// to dispatcher at all, so subscribers only ever receive the two event
+// types the stream handler can detect, and only while something is
+// streaming that code.
+func New(ctx context.Context, cfg *config.APIServerConfig, db *database.Database, h render.Renderer, dispatcher *events.Dispatcher) (*Controller, error) {
+	return &Controller{
+		config:     cfg,
+		db:         db,
+		h:          h,
+		dispatcher: dispatcher,
+		logger:     logging.FromContext(ctx).Named("eventsapi"),
+	}, nil
+}
+
+func (c *Controller) realmFromAuthorization(authApp *database.AuthorizedApp, realm *database.Realm) (*database.Realm, error) {
+	if realm != nil {
+		return realm, nil
+	}
+	if authApp == nil {
+		return nil, fmt.Errorf("missing realm")
+	}
+	return authApp.Realm(c.db)
+}
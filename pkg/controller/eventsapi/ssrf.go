@@ -0,0 +1,69 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsapi
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// validateCallbackURL rejects callback URLs that would make the apiserver's
+// outbound webhook client reach loopback, link-local, or other private
+// infrastructure (e.g. the cloud metadata endpoint at 169.254.169.254) in
+// addition to requiring https, so a realm can't use a subscription to probe
+// the server's own network.
+func validateCallbackURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("callbackURL is not a valid URL: %w", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("callbackURL must be https")
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("callbackURL is missing a host")
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve callbackURL host: %w", err)
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("callbackURL host did not resolve to any address")
+	}
+
+	for _, ip := range ips {
+		if isDisallowedCallbackIP(ip) {
+			return fmt.Errorf("callbackURL resolves to a private or reserved address")
+		}
+	}
+	return nil
+}
+
+// isDisallowedCallbackIP reports whether ip is loopback, private-use,
+// link-local (unicast or multicast), unspecified, or multicast. Other
+// special-purpose ranges, such as shared address space (100.64.0.0/10), are
+// not rejected.
+func isDisallowedCallbackIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() ||
+		ip.IsMulticast()
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsapi
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsDisallowedCallbackIP(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{name: "loopback v4", ip: "127.0.0.1", want: true},
+		{name: "loopback v6", ip: "::1", want: true},
+		{name: "link-local metadata endpoint", ip: "169.254.169.254", want: true},
+		{name: "private 10/8", ip: "10.0.0.5", want: true},
+		{name: "private 192.168/16", ip: "192.168.1.1", want: true},
+		{name: "unspecified", ip: "0.0.0.0", want: true},
+		{name: "multicast", ip: "224.0.0.1", want: true},
+		{name: "public address", ip: "8.8.8.8", want: false},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			ip := net.ParseIP(c.ip)
+			if ip == nil {
+				t.Fatalf("failed to parse test IP %q", c.ip)
+			}
+			if got := isDisallowedCallbackIP(ip); got != c.want {
+				t.Errorf("isDisallowedCallbackIP(%q) = %v, want %v", c.ip, got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "non-https rejected", url: "http://example.com/callback", wantErr: true},
+		{name: "missing host rejected", url: "https:///callback", wantErr: true},
+		{name: "malformed url rejected", url: "://not-a-url", wantErr: true},
+		{name: "loopback host rejected", url: "https://127.0.0.1/callback", wantErr: true},
+		{name: "metadata address rejected", url: "https://169.254.169.254/callback", wantErr: true},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateCallbackURL(c.url)
+			if c.wantErr && err == nil {
+				t.Errorf("validateCallbackURL(%q) = nil, want error", c.url)
+			}
+			if !c.wantErr && err != nil {
+				t.Errorf("validateCallbackURL(%q) = %v, want nil", c.url, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// HandleSubscribe registers a webhook subscription for verification-code
+// lifecycle events on the caller's realm.
+func (c *Controller) HandleSubscribe() http.Handler {
+	logger := c.logger.Named("HandleSubscribe")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var request api.EventSubscriptionRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		if request.CallbackURL == "" {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("callbackURL is required"))
+			return
+		}
+		if err := validateCallbackURL(request.CallbackURL); err != nil {
+			logger.Debugw("rejected callbackURL", "callbackURL", request.CallbackURL, "error", err)
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("callbackURL is invalid: %v", err))
+			return
+		}
+
+		authApp, _ := middleware.AuthorizedAppFromContext(ctx)
+		realm, err := c.realmFromAuthorization(authApp, controller.RealmFromContext(ctx))
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("missing realm"))
+			return
+		}
+
+		secret, err := randomHexSecret()
+		if err != nil {
+			logger.Errorw("failed to generate subscription secret", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError,
+				api.Errorf("failed to register subscription, please try again"))
+			return
+		}
+
+		sub := &database.EventSubscription{
+			RealmID:       realm.ID,
+			CallbackURL:   request.CallbackURL,
+			HMACSecret:    secret,
+			EventTypesRaw: strings.Join(request.EventTypes, ","),
+			CodeUUID:      request.CodeUUID,
+		}
+		if err := c.db.SaveEventSubscription(sub); err != nil {
+			logger.Errorw("failed to save event subscription", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError,
+				api.Errorf("failed to register subscription, please try again"))
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, &api.EventSubscriptionResponse{
+			SubscriptionID: sub.UUID,
+			HMACSecret:     secret,
+		})
+	})
+}
+
+// HandleUnsubscribe removes a previously registered webhook subscription.
+func (c *Controller) HandleUnsubscribe() http.Handler {
+	logger := c.logger.Named("HandleUnsubscribe")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var request api.UnsubscribeRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
+			return
+		}
+
+		authApp, _ := middleware.AuthorizedAppFromContext(ctx)
+		realm, err := c.realmFromAuthorization(authApp, controller.RealmFromContext(ctx))
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("missing realm"))
+			return
+		}
+
+		if err := c.db.DeleteEventSubscription(realm.ID, request.SubscriptionID); err != nil {
+			logger.Errorw("failed to delete event subscription", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError,
+				api.Errorf("failed to remove subscription, please try again"))
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, nil)
+	})
+}
+
+func randomHexSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -26,85 +26,84 @@ func (c *Controller) HandleCheckCodeStatus() http.Handler {
 	logger := c.logger.Named("issueapi.CheckCodeStatus")
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-
 		var request api.CheckCodeStatusRequest
 		if err := controller.BindJSON(w, r, &request); err != nil {
 			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
 			return
 		}
 
-		authApp, user, err := c.getAuthorizationFromContext(r)
-		if err != nil {
-			c.h.RenderJSON(w, http.StatusUnauthorized, api.Error(err))
-			return
-		}
-		if user == nil {
-			logger.Errorw("failed to check otp code status", "error", "user email does not match issuing user")
-			c.h.RenderJSON(w, http.StatusUnauthorized,
-				api.Errorf("failed to check otp code status: user does not match issuing user").WithCode(api.ErrVerifyCodeUserUnauth))
+		code, _, httpStatus, apiErr := c.resolveCodeForStatusCheck(r, request.UUID)
+		if apiErr != nil {
+			logger.Errorw("failed to check otp code status", "error", apiErr)
+			c.h.RenderJSON(w, httpStatus, apiErr)
 			return
 		}
 
-		var realm *database.Realm
-		if authApp != nil {
-			realm, err = authApp.Realm(c.db)
-			if err != nil {
-				c.h.RenderJSON(w, http.StatusUnauthorized, nil)
-				return
-			}
-		} else {
-			// if it's a user logged in, we can pull realm from the context.
-			realm = controller.RealmFromContext(ctx)
-		}
-		if realm == nil {
-			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("missing realm"))
-			return
-		}
+		c.h.RenderJSON(w, http.StatusOK,
+			&api.CheckCodeStatusResponse{
+				Claimed:            code.Claimed,
+				ExpiresAtTimestamp: code.ExpiresAt.UTC().Unix(),
+			})
+	})
+}
+
+// resolveCodeForStatusCheck resolves the verification code identified by
+// uuid and authorizes r's caller (the issuing user or a realm admin) to view
+// its status. It's shared by the polling HandleCheckCodeStatus handler and
+// the streaming HandleCheckCodeStatusStream handler so the two never drift
+// in what they consider authorized.
+func (c *Controller) resolveCodeForStatusCheck(r *http.Request, uuid string) (code *database.VerificationCode, realm *database.Realm, httpStatus int, apiErr *api.ErrorReturn) {
+	ctx := r.Context()
+
+	authApp, user, err := c.getAuthorizationFromContext(r)
+	if err != nil {
+		return nil, nil, http.StatusUnauthorized, api.Error(err)
+	}
+	if user == nil {
+		return nil, nil, http.StatusUnauthorized,
+			api.Errorf("failed to check otp code status: user does not match issuing user").WithCode(api.ErrVerifyCodeUserUnauth)
+	}
 
-		code, err := c.db.FindVerificationCodeByUUID(request.UUID)
+	if authApp != nil {
+		realm, err = authApp.Realm(c.db)
 		if err != nil {
-			logger.Errorw("failed to check otp code status", "error", err)
-			c.h.RenderJSON(w, http.StatusInternalServerError,
-				api.Errorf("failed to check otp code status, please try again").WithCode(api.ErrInternal))
-			return
+			return nil, nil, http.StatusUnauthorized,
+				api.Errorf("failed to check otp code status: unable to resolve realm").WithCode(api.ErrVerifyCodeUserUnauth)
 		}
+	} else {
+		// if it's a user logged in, we can pull realm from the context.
+		realm = controller.RealmFromContext(ctx)
+	}
+	if realm == nil {
+		return nil, nil, http.StatusBadRequest, api.Errorf("missing realm")
+	}
 
-		logger.Debugw("Found code", "verificationCode", code)
+	code, err = c.db.FindVerificationCodeByUUID(uuid)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError,
+			api.Errorf("failed to check otp code status, please try again").WithCode(api.ErrInternal)
+	}
 
-		if code.UUID == "" { // if no row is found, code will not be populated
-			logger.Errorw("failed to check otp code status", "error", "code not found")
-			c.h.RenderJSON(w, http.StatusNotFound,
-				api.Errorf("failed to check otp code status").WithCode(api.ErrVerifyCodeNotFound))
-			return
-		}
+	if code.UUID == "" { // if no row is found, code will not be populated
+		return nil, nil, http.StatusNotFound,
+			api.Errorf("failed to check otp code status").WithCode(api.ErrVerifyCodeNotFound)
+	}
 
-		// The current user must have issued the code or be a realm admin.
-		if !(code.IssuingUser != nil && code.IssuingUser.Email == user.Email || user.CanAdminRealm(realm.ID)) {
-			logger.Errorw("failed to check otp code status", "error", "user email does not match issuing user")
-			c.h.RenderJSON(w, http.StatusUnauthorized,
-				api.Errorf("failed to check otp code status: user does not match issuing user").WithCode(api.ErrVerifyCodeUserUnauth))
-			return
-		}
+	// The current user must have issued the code or be a realm admin.
+	if !(code.IssuingUser != nil && code.IssuingUser.Email == user.Email || user.CanAdminRealm(realm.ID)) {
+		return nil, nil, http.StatusUnauthorized,
+			api.Errorf("failed to check otp code status: user does not match issuing user").WithCode(api.ErrVerifyCodeUserUnauth)
+	}
 
-		if code.IsExpired() {
-			logger.Errorw("failed to check otp code status", "error", "code exists but has expired")
-			c.h.RenderJSON(w, http.StatusNotFound,
-				api.Errorf("code has expired").WithCode(api.ErrVerifyCodeExpired))
-			return
-		}
+	if code.IsExpired() {
+		return nil, nil, http.StatusNotFound,
+			api.Errorf("code has expired").WithCode(api.ErrVerifyCodeExpired)
+	}
 
-		if code.RealmID != realm.ID {
-			logger.Errorw("failed to check otp code status", "error", "realmID does not match")
-			c.h.RenderJSON(w, http.StatusNotFound,
-				api.Errorf("code does not exist").WithCode(api.ErrVerifyCodeNotFound))
-			return
-		}
+	if code.RealmID != realm.ID {
+		return nil, nil, http.StatusNotFound,
+			api.Errorf("code does not exist").WithCode(api.ErrVerifyCodeNotFound)
+	}
 
-		c.h.RenderJSON(w, http.StatusOK,
-			&api.CheckCodeStatusResponse{
-				Claimed:            code.Claimed,
-				ExpiresAtTimestamp: code.ExpiresAt.UTC().Unix(),
-			})
-	})
-}
\ No newline at end of file
+	return code, realm, http.StatusOK, nil
+}
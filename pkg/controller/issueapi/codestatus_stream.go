@@ -0,0 +1,228 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/events"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+)
+
+// statusPollInterval is how often the stream handler re-checks the database
+// for a claim/expiry. Polling (rather than requiring an in-process pub/sub
+// hook shared across apiserver instances) keeps the stream correct behind a
+// load balancer, at the cost of up to one interval of latency.
+const statusPollInterval = 1 * time.Second
+
+// maxOpenStreamsPerRealm bounds the number of status streams a single realm
+// may hold open at once. The request-rate limiter installed ahead of this
+// handler already bounds how often a realm can *open* a stream; since a
+// stream is long-lived rather than one-shot, that alone doesn't stop a realm
+// from accumulating thousands of open connections and exhausting the
+// server's file descriptors, so connections are additionally accounted for
+// here for as long as they're held open.
+const maxOpenStreamsPerRealm = 250
+
+// openStreamsByRealm tracks the number of in-flight status streams per
+// realm ID across all requests served by this process.
+var openStreamsByRealm sync.Map // map[uint]*int32
+
+// acquireStreamSlot reserves one of realmID's open-stream slots, returning
+// false if the realm is already at maxOpenStreamsPerRealm.
+func acquireStreamSlot(realmID uint) bool {
+	v, _ := openStreamsByRealm.LoadOrStore(realmID, new(int32))
+	count := v.(*int32)
+	if atomic.AddInt32(count, 1) > maxOpenStreamsPerRealm {
+		atomic.AddInt32(count, -1)
+		return false
+	}
+	return true
+}
+
+// releaseStreamSlot returns the slot reserved by a prior, successful call
+// to acquireStreamSlot.
+func releaseStreamSlot(realmID uint) {
+	if v, ok := openStreamsByRealm.Load(realmID); ok {
+		atomic.AddInt32(v.(*int32), -1)
+	}
+}
+
+// dispatchedEventTTL is the age past which a codeUUID's entry in
+// dispatchedTerminalEvents is evicted. The sweep that evicts entries runs
+// once per dispatchedEventTTL, so an entry can be held for up to twice this
+// long after its terminal event fires. Verification
+// codes are short-lived, so an hour comfortably covers every client still
+// able to stream a terminal transition for the same code; past that the
+// entry is just heap the process would otherwise hold forever.
+const dispatchedEventTTL = 1 * time.Hour
+
+// dispatchedTerminalEvents remembers which codes have already had their
+// terminal (claimed/expired) lifecycle event dispatched, so that multiple
+// clients streaming the same code's status don't each fire a duplicate
+// webhook callback. Like openStreamsByRealm, this is process-local: behind a
+// load balancer with multiple apiserver instances, two instances could each
+// independently detect the same transition and dispatch twice. Subscribers
+// should treat delivery as at-least-once. Entries are pruned by
+// pruneDispatchedTerminalEvents once they're older than dispatchedEventTTL,
+// so this doesn't grow for the life of the process.
+var dispatchedTerminalEvents sync.Map // map[string]time.Time
+
+var startDispatchedEventsPrunerOnce sync.Once
+
+// startDispatchedEventsPruner launches the background sweep that evicts
+// dispatchedTerminalEvents entries older than dispatchedEventTTL. It's
+// started lazily, the first time an event is dispatched, so tests and
+// binaries that never stream a code never pay for the goroutine.
+func startDispatchedEventsPruner() {
+	go func() {
+		ticker := time.NewTicker(dispatchedEventTTL)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			now := time.Now()
+			dispatchedTerminalEvents.Range(func(key, value interface{}) bool {
+				if dispatchedAt, ok := value.(time.Time); ok && now.Sub(dispatchedAt) > dispatchedEventTTL {
+					dispatchedTerminalEvents.Delete(key)
+				}
+				return true
+			})
+		}
+	}()
+}
+
+// dispatchTerminalEventOnce dispatches ev unless this process has already
+// dispatched a terminal event for codeUUID, returning true if it dispatched.
+//
+// ctx must not be (or be derived from) the triggering request's context:
+// Dispatch hands delivery off to a goroutine that retries with backoff for
+// up to about a minute, and a request's context is canceled the moment its
+// handler returns, which happens immediately after this call in
+// HandleCheckCodeStatusStream. Callers should pass a context detached from
+// any single request's lifetime.
+func (c *Controller) dispatchTerminalEventOnce(ctx context.Context, codeUUID string, ev *events.Event) bool {
+	startDispatchedEventsPrunerOnce.Do(startDispatchedEventsPruner)
+
+	if _, alreadyDispatched := dispatchedTerminalEvents.LoadOrStore(codeUUID, time.Now()); alreadyDispatched {
+		return false
+	}
+	c.dispatcher.Dispatch(ctx, ev)
+	return true
+}
+
+// HandleCheckCodeStatusStream upgrades to a Server-Sent Events stream that
+// emits "claimed", "expired", and periodic "keepalive" events for a single
+// verification code, so device apps and admin dashboards no longer need to
+// poll HandleCheckCodeStatus once per second. It also dispatches the
+// corresponding CodeClaimed/CodeExpired webhook event the first time this
+// process observes the transition (see dispatchTerminalEventOnce), via the
+// dispatcher supplied when this Controller was constructed. CodeIssued and
+// CertificateIssued are not dispatched from here, nor from anywhere else in
+// this server.
+func (c *Controller) HandleCheckCodeStatusStream() http.Handler {
+	logger := c.logger.Named("issueapi.CheckCodeStatusStream")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uuid := r.URL.Query().Get("uuid")
+		if uuid == "" {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("missing uuid"))
+			return
+		}
+
+		code, realm, httpStatus, apiErr := c.resolveCodeForStatusCheck(r, uuid)
+		if apiErr != nil {
+			logger.Errorw("failed to open code status stream", "error", apiErr)
+			c.h.RenderJSON(w, httpStatus, apiErr)
+			return
+		}
+
+		if !acquireStreamSlot(realm.ID) {
+			c.h.RenderJSON(w, http.StatusTooManyRequests,
+				api.Errorf("too many open status streams for this realm, try polling instead"))
+			return
+		}
+		defer releaseStreamSlot(realm.ID)
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.Errorf("streaming unsupported"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		idle := time.NewTimer(time.Until(code.ExpiresAt))
+		defer idle.Stop()
+
+		poll := time.NewTicker(statusPollInterval)
+		defer poll.Stop()
+
+		ctx := r.Context()
+
+		// dispatchCtx carries the request's logger but, unlike ctx, is not
+		// canceled when the handler returns, so the dispatcher's
+		// fire-and-forget retry goroutine (which can run for up to about a
+		// minute) isn't killed the instant this stream closes.
+		dispatchCtx := logging.WithLogger(context.Background(), logger)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-idle.C:
+				c.dispatchTerminalEventOnce(dispatchCtx, code.UUID, events.New(events.CodeExpired, realm.ID, code.UUID))
+				writeSSEEvent(w, "expired", `{"claimed":false}`)
+				flusher.Flush()
+				return
+
+			case <-poll.C:
+				fresh, err := c.db.FindVerificationCodeByUUID(code.UUID)
+				if err != nil {
+					logger.Errorw("failed to poll code status", "error", err)
+					continue
+				}
+				if fresh.Claimed {
+					c.dispatchTerminalEventOnce(dispatchCtx, code.UUID, events.New(events.CodeClaimed, realm.ID, code.UUID))
+					writeSSEEvent(w, "claimed", `{"claimed":true}`)
+					flusher.Flush()
+					return
+				}
+				if fresh.IsExpired() {
+					c.dispatchTerminalEventOnce(dispatchCtx, code.UUID, events.New(events.CodeExpired, realm.ID, code.UUID))
+					writeSSEEvent(w, "expired", `{"claimed":false}`)
+					flusher.Flush()
+					return
+				}
+				writeSSEEvent(w, "keepalive", `{}`)
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+func writeSSEEvent(w http.ResponseWriter, event, data string) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcquireReleaseStreamSlot(t *testing.T) {
+	// Not t.Parallel(): acquireStreamSlot/releaseStreamSlot share
+	// package-level state (openStreamsByRealm) keyed by realm ID, so a
+	// fresh, never-used realm ID is used to avoid bleeding into other tests.
+	const realmID = uint(987654321)
+
+	for i := 0; i < maxOpenStreamsPerRealm; i++ {
+		if !acquireStreamSlot(realmID) {
+			t.Fatalf("acquireStreamSlot() returned false on slot %d, want true (under the cap)", i)
+		}
+	}
+
+	if acquireStreamSlot(realmID) {
+		t.Error("acquireStreamSlot() returned true once the realm was at maxOpenStreamsPerRealm, want false")
+	}
+
+	releaseStreamSlot(realmID)
+
+	if !acquireStreamSlot(realmID) {
+		t.Error("acquireStreamSlot() returned false after a slot was released, want true")
+	}
+
+	for i := 0; i < maxOpenStreamsPerRealm; i++ {
+		releaseStreamSlot(realmID)
+	}
+}
+
+func TestWriteSSEEvent(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	writeSSEEvent(w, "claimed", `{"claimed":true}`)
+
+	want := "event: claimed\ndata: {\"claimed\":true}\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("writeSSEEvent() wrote %q, want %q", got, want)
+	}
+}
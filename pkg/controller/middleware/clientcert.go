@@ -0,0 +1,168 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+
+	"github.com/gorilla/mux"
+)
+
+// errNoTrustedChain is returned when a presented client certificate does not
+// chain to any realm's trust bundle.
+var errNoTrustedChain = errors.New("no realm trust bundle verifies this certificate")
+
+// trustBundleCacheTTL bounds how long the parsed, per-realm CA pools are
+// reused before being reloaded from the database. Without this, every single
+// mTLS request loaded and re-parsed every realm's entire trust bundle, even
+// though new trust bundles are registered rarely compared to request volume.
+const trustBundleCacheTTL = 30 * time.Second
+
+var (
+	trustBundleMu     sync.Mutex
+	trustBundleCached map[uint]*x509.CertPool
+	trustBundleExpiry time.Time
+)
+
+// InvalidateTrustBundleCache forces the next mTLS request to reload every
+// realm's trust bundle from the database, instead of waiting out
+// trustBundleCacheTTL. It's called after a RealmTrustedCA row is added (see
+// adminapi.HandleAddTrustedCA) so the change takes effect immediately.
+func InvalidateTrustBundleCache() {
+	trustBundleMu.Lock()
+	defer trustBundleMu.Unlock()
+	trustBundleCached = nil
+}
+
+// loadTrustBundlePools returns the parsed CA pool for every realm that has
+// one configured, reloading from the database at most once per
+// trustBundleCacheTTL.
+func loadTrustBundlePools(db *database.Database) (map[uint]*x509.CertPool, error) {
+	trustBundleMu.Lock()
+	defer trustBundleMu.Unlock()
+
+	if trustBundleCached != nil && time.Now().Before(trustBundleExpiry) {
+		return trustBundleCached, nil
+	}
+
+	bundles, err := db.FindAllTrustedCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	pools := make(map[uint]*x509.CertPool, len(bundles))
+	for realmID, cas := range bundles {
+		pool := x509.NewCertPool()
+		for _, ca := range cas {
+			pool.AppendCertsFromPEM([]byte(ca.PEM))
+		}
+		pools[realmID] = pool
+	}
+
+	trustBundleCached = pools
+	trustBundleExpiry = time.Now().Add(trustBundleCacheTTL)
+	return pools, nil
+}
+
+// RequireClientCert authenticates device requests using the peer certificate
+// presented during the TLS handshake, as an alternative to the X-API-Key
+// header enforced by RequireAPIKey. The peer certificate's chain is
+// validated against the trust bundle of every realm that has one configured,
+// and the leaf certificate's first DNS SAN is used to look up the
+// corresponding device AuthorizedApp.
+//
+// If the request presents no client certificate, the request falls through
+// to fallback unmodified, so both authentication modes can coexist behind
+// the same router and rate limiter.
+func RequireClientCert(ctx context.Context, db *database.Database, h render.Renderer, fallback mux.MiddlewareFunc) mux.MiddlewareFunc {
+	logger := logging.FromContext(ctx).Named("middleware.RequireClientCert")
+
+	return func(next http.Handler) http.Handler {
+		fallbackNext := fallback(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+				fallbackNext.ServeHTTP(w, r)
+				return
+			}
+
+			leaf := r.TLS.PeerCertificates[0]
+
+			trustPools, err := loadTrustBundlePools(db)
+			if err != nil {
+				logger.Errorw("failed to load trust bundles", "error", err)
+				h.RenderJSON(w, http.StatusInternalServerError, api.Errorf("failed to authenticate request"))
+				return
+			}
+
+			realmID, err := verifyAgainstTrustBundles(leaf, r.TLS.PeerCertificates[1:], trustPools)
+			if err != nil {
+				logger.Debugw("client certificate not trusted", "error", err)
+				h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("invalid client certificate"))
+				return
+			}
+
+			if len(leaf.DNSNames) == 0 {
+				logger.Debugw("client certificate has no DNS SAN", "realmID", realmID)
+				h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("invalid client certificate"))
+				return
+			}
+			san := leaf.DNSNames[0]
+
+			authApp, err := db.FindAuthorizedAppByClientCertSAN(realmID, san)
+			if err != nil {
+				logger.Debugw("no authorized app for client certificate", "realmID", realmID, "san", san, "error", err)
+				h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("invalid client certificate"))
+				return
+			}
+
+			ctx := WithAuthorizedApp(r.Context(), authApp)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// verifyAgainstTrustBundles verifies leaf (with the rest of the presented
+// chain as intermediates) against each realm's trust bundle in turn,
+// returning the ID of the first realm whose bundle verifies the chain.
+func verifyAgainstTrustBundles(leaf *x509.Certificate, intermediates []*x509.Certificate, trustPools map[uint]*x509.CertPool) (uint, error) {
+	intermediatePool := x509.NewCertPool()
+	for _, c := range intermediates {
+		intermediatePool.AddCert(c)
+	}
+
+	for realmID, rootPool := range trustPools {
+		if _, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         rootPool,
+			Intermediates: intermediatePool,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err == nil {
+			return realmID, nil
+		}
+	}
+
+	return 0, errNoTrustedChain
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// userContextKey is its own unexported type, rather than a shared
+// contextKey string constant, so that adding it here can't collide with
+// whatever private key type RequireAPIKey/RequireClientCert already use to
+// store the resolved AuthorizedApp (see WithAuthorizedApp/
+// AuthorizedAppFromContext, both of which predate this file).
+type userContextKey struct{}
+
+// WithUser stores the User resolved by the request's user-JWT authentication
+// middleware (the admin console's login session path) in the context.
+func WithUser(ctx context.Context, user *database.User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext returns the User stored in the context by the user-JWT
+// authentication middleware, if any.
+func UserFromContext(ctx context.Context) (*database.User, bool) {
+	user, ok := ctx.Value(userContextKey{}).(*database.User)
+	return user, ok && user != nil
+}
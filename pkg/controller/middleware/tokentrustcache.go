@@ -0,0 +1,253 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// errAuthNotCacheable is returned internally from a TokenTrustCache lookup
+// when the wrapped authentication chain rejected the request. It signals
+// CacheTokenTrust to leave the response (already written by the fallback
+// chain) alone rather than treating it as a cache-populate failure.
+var errAuthNotCacheable = errors.New("request was not authenticated, nothing to cache")
+
+// TokenTrustCacheConfig configures the per-request token-trust-verification
+// cache that CacheTokenTrust installs in front of an authentication
+// middleware chain. The apiserver installs it in front of its
+// RequireClientCert/RequireAPIKey chain only; no user-JWT lookup is wrapped
+// by it in this server.
+type TokenTrustCacheConfig struct {
+	// Enabled toggles the cache. When false, every request pays the full
+	// database round-trip, which is useful when chasing a suspected
+	// staleness bug during an incident.
+	Enabled bool `env:"TOKEN_TRUST_CACHE_ENABLED, default=true"`
+
+	// CacheExpiration bounds how long a resolved trust decision is reused
+	// before the next request for the same credential re-verifies it
+	// against the database. It is also the worst-case window before a
+	// disabled API key or deleted user stops being honored, for callers
+	// that don't hit HandleInvalidateTokenCache.
+	CacheExpiration time.Duration `env:"TOKEN_TRUST_CACHE_EXPIRATION, default=30s"`
+
+	// HMACKey derives the cache key from the presented credential so that
+	// raw API keys and JWTs never themselves appear in the cache.
+	HMACKey []byte `env:"TOKEN_TRUST_CACHE_HMAC_KEY, required"`
+}
+
+type tokenTrustEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// TokenTrustCache caches the outcome of resolving a presented credential
+// (an X-API-Key value or a user JWT) to its AuthorizedApp or User, keyed by
+// an HMAC of the credential so the cache never stores secrets in the clear.
+// It's invalidated wholesale rather than per-key, since realm and
+// authorized-app mutations (disabling a key, removing a user) are rare
+// compared to the request volume it saves a database round-trip for.
+type TokenTrustCache struct {
+	config *TokenTrustCacheConfig
+
+	mu      sync.RWMutex
+	entries map[string]tokenTrustEntry
+
+	hits   metric.Int64Counter
+	misses metric.Int64Counter
+}
+
+// NewTokenTrustCache creates a TokenTrustCache per config.
+func NewTokenTrustCache(ctx context.Context, config *TokenTrustCacheConfig) (*TokenTrustCache, error) {
+	meter := otel.Meter("apiserver.tokentrustcache")
+
+	hits, err := meter.Int64Counter("token_trust_cache.hits",
+		metric.WithDescription("Count of token-trust-verification cache hits"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token_trust_cache.hits counter: %w", err)
+	}
+
+	misses, err := meter.Int64Counter("token_trust_cache.misses",
+		metric.WithDescription("Count of token-trust-verification cache misses"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token_trust_cache.misses counter: %w", err)
+	}
+
+	return &TokenTrustCache{
+		config:  config,
+		entries: make(map[string]tokenTrustEntry),
+		hits:    hits,
+		misses:  misses,
+	}, nil
+}
+
+// Resolve returns the cached value for credential, calling lookup on a
+// cache miss (or whenever the cache is disabled) and caching a successful
+// result for config.CacheExpiration.
+func (t *TokenTrustCache) Resolve(ctx context.Context, credential string, lookup func() (interface{}, error)) (interface{}, error) {
+	if !t.config.Enabled {
+		return lookup()
+	}
+
+	key := t.key(credential)
+
+	if v, ok := t.get(key); ok {
+		t.hits.Add(ctx, 1)
+		return v, nil
+	}
+	t.misses.Add(ctx, 1)
+
+	v, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+
+	t.set(key, v)
+	return v, nil
+}
+
+// Invalidate evicts every cached trust decision, forcing the next request
+// for each credential to re-verify against the database. It's called by
+// adminapi.HandleInvalidateTokenCache for incident response, and should
+// also be called whenever a realm or AuthorizedApp is mutated (a key is
+// disabled, a user is removed, and so on) so revocation never has to wait
+// out a full CacheExpiration window.
+func (t *TokenTrustCache) Invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = make(map[string]tokenTrustEntry)
+}
+
+func (t *TokenTrustCache) key(credential string) string {
+	mac := hmac.New(sha256.New, t.config.HMACKey)
+	mac.Write([]byte(credential))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (t *TokenTrustCache) get(key string) (interface{}, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	entry, ok := t.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (t *TokenTrustCache) set(key string, value interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries[key] = tokenTrustEntry{
+		value:     value,
+		expiresAt: time.Now().Add(t.config.CacheExpiration),
+	}
+}
+
+// bearerToken returns the token from a "Authorization: Bearer <token>"
+// header, or "" if the header is absent or malformed. This is how the
+// admin console's user-JWT authentication middleware expects the session
+// token to be presented.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(auth, prefix)
+}
+
+// resolvedTrust bundles whichever identity fallback resolved the presented
+// credential to: an AuthorizedApp for an X-API-Key, or a User for a JWT.
+type resolvedTrust struct {
+	authApp *database.AuthorizedApp
+	user    *database.User
+}
+
+// CacheTokenTrust wraps fallback (ordinarily RequireClientCert/RequireAPIKey
+// for device endpoints, or the admin console's user-JWT middleware) with
+// cache, so that an AuthorizedApp or User already resolved for a given
+// credential within the last CacheExpiration is reused instead of
+// re-querying the database. Requests presenting neither an X-API-Key nor a
+// bearer token (for example, mTLS-only devices), or whose credential isn't
+// yet cached, fall through to fallback unmodified; fallback's result is
+// captured and cached for next time.
+func CacheTokenTrust(ctx context.Context, cache *TokenTrustCache, fallback mux.MiddlewareFunc) mux.MiddlewareFunc {
+	logger := logging.FromContext(ctx).Named("middleware.CacheTokenTrust")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credential := r.Header.Get("X-API-Key")
+			if credential == "" {
+				credential = bearerToken(r)
+			}
+			if credential == "" {
+				fallback(next).ServeHTTP(w, r)
+				return
+			}
+
+			var resolved resolvedTrust
+			v, err := cache.Resolve(r.Context(), credential, func() (interface{}, error) {
+				var authenticated bool
+				probe := http.HandlerFunc(func(_ http.ResponseWriter, pr *http.Request) {
+					authenticated = true
+					resolved.authApp, _ = AuthorizedAppFromContext(pr.Context())
+					resolved.user, _ = UserFromContext(pr.Context())
+				})
+
+				fallback(probe).ServeHTTP(w, r)
+				if !authenticated {
+					return nil, errAuthNotCacheable
+				}
+				return resolved, nil
+			})
+			if err == errAuthNotCacheable {
+				// fallback already wrote the rejection response.
+				return
+			}
+			if err != nil {
+				logger.Errorw("failed to resolve token trust", "error", err)
+				return
+			}
+
+			trust, _ := v.(resolvedTrust)
+			reqCtx := r.Context()
+			if trust.authApp != nil {
+				reqCtx = WithAuthorizedApp(reqCtx, trust.authApp)
+			}
+			if trust.user != nil {
+				reqCtx = WithUser(reqCtx, trust.user)
+			}
+			next.ServeHTTP(w, r.WithContext(reqCtx))
+		})
+	}
+}
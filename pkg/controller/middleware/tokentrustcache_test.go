@@ -0,0 +1,304 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/gorilla/mux"
+)
+
+func testTokenTrustCache(t *testing.T, expiration time.Duration) *TokenTrustCache {
+	t.Helper()
+
+	cache, err := NewTokenTrustCache(context.Background(), &TokenTrustCacheConfig{
+		Enabled:         true,
+		CacheExpiration: expiration,
+		HMACKey:         []byte("test-hmac-key"),
+	})
+	if err != nil {
+		t.Fatalf("NewTokenTrustCache() failed: %v", err)
+	}
+	return cache
+}
+
+func TestTokenTrustCache_Resolve(t *testing.T) {
+	t.Parallel()
+
+	cache := testTokenTrustCache(t, time.Minute)
+
+	calls := 0
+	lookup := func() (interface{}, error) {
+		calls++
+		return "resolved-value", nil
+	}
+
+	for i := 0; i < 3; i++ {
+		v, err := cache.Resolve(context.Background(), "some-credential", lookup)
+		if err != nil {
+			t.Fatalf("Resolve() failed: %v", err)
+		}
+		if v != "resolved-value" {
+			t.Errorf("Resolve() = %v, want %q", v, "resolved-value")
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("lookup was called %d times, want 1 (subsequent calls should hit the cache)", calls)
+	}
+}
+
+func TestTokenTrustCache_ResolveDoesNotCacheErrors(t *testing.T) {
+	t.Parallel()
+
+	cache := testTokenTrustCache(t, time.Minute)
+
+	wantErr := errors.New("lookup failed")
+	calls := 0
+	lookup := func() (interface{}, error) {
+		calls++
+		return nil, wantErr
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Resolve(context.Background(), "some-credential", lookup); !errors.Is(err, wantErr) {
+			t.Fatalf("Resolve() error = %v, want %v", err, wantErr)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("lookup was called %d times, want 2 (a failed lookup should never be cached)", calls)
+	}
+}
+
+func TestTokenTrustCache_ResolveExpires(t *testing.T) {
+	t.Parallel()
+
+	cache := testTokenTrustCache(t, time.Millisecond)
+
+	calls := 0
+	lookup := func() (interface{}, error) {
+		calls++
+		return "resolved-value", nil
+	}
+
+	if _, err := cache.Resolve(context.Background(), "some-credential", lookup); err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := cache.Resolve(context.Background(), "some-credential", lookup); err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("lookup was called %d times, want 2 (expired entries must not be reused)", calls)
+	}
+}
+
+func TestTokenTrustCache_Invalidate(t *testing.T) {
+	t.Parallel()
+
+	cache := testTokenTrustCache(t, time.Minute)
+
+	calls := 0
+	lookup := func() (interface{}, error) {
+		calls++
+		return "resolved-value", nil
+	}
+
+	if _, err := cache.Resolve(context.Background(), "some-credential", lookup); err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+
+	cache.Invalidate()
+
+	if _, err := cache.Resolve(context.Background(), "some-credential", lookup); err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("lookup was called %d times, want 2 (Invalidate must evict all entries)", calls)
+	}
+}
+
+func TestTokenTrustCache_ResolveDisabled(t *testing.T) {
+	t.Parallel()
+
+	cache := testTokenTrustCache(t, time.Minute)
+	cache.config.Enabled = false
+
+	calls := 0
+	lookup := func() (interface{}, error) {
+		calls++
+		return "resolved-value", nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Resolve(context.Background(), "some-credential", lookup); err != nil {
+			t.Fatalf("Resolve() failed: %v", err)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("lookup was called %d times, want 2 (a disabled cache must not short-circuit lookups)", calls)
+	}
+}
+
+func TestTokenTrustCache_KeyDoesNotLeakCredential(t *testing.T) {
+	t.Parallel()
+
+	cache := testTokenTrustCache(t, time.Minute)
+
+	key := cache.key("super-secret-api-key")
+	if key == "super-secret-api-key" {
+		t.Error("key() returned the raw credential instead of an HMAC digest")
+	}
+	if len(key) == 0 {
+		t.Error("key() returned an empty digest")
+	}
+}
+
+// TestCacheTokenTrust_PropagatesAuthorizedApp drives CacheTokenTrust end to
+// end: a fallback chain that resolves an X-API-Key to an AuthorizedApp (the
+// way RequireAPIKey/RequireClientCert do, via WithAuthorizedApp) wrapped by
+// CacheTokenTrust, down to a downstream handler that reads
+// AuthorizedAppFromContext. This guards against CacheTokenTrust populating
+// some cache-local mechanism that the rest of the request pipeline never
+// actually reads.
+func TestCacheTokenTrust_PropagatesAuthorizedApp(t *testing.T) {
+	t.Parallel()
+
+	cache := testTokenTrustCache(t, time.Minute)
+	wantApp := &database.AuthorizedApp{}
+
+	fallbackCalls := 0
+	fallback := mux.MiddlewareFunc(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fallbackCalls++
+			next.ServeHTTP(w, r.WithContext(WithAuthorizedApp(r.Context(), wantApp)))
+		})
+	})
+
+	var gotApp *database.AuthorizedApp
+	downstreamCalls := 0
+	downstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstreamCalls++
+		gotApp, _ = AuthorizedAppFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := CacheTokenTrust(context.Background(), cache, fallback)(downstream)
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/api/verify", nil)
+		r.Header.Set("X-API-Key", "some-api-key")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+	}
+
+	if downstreamCalls != 2 {
+		t.Fatalf("downstream handler was called %d times, want 2", downstreamCalls)
+	}
+	if fallbackCalls != 1 {
+		t.Errorf("fallback was called %d times, want 1 (the second request should be served from cache)", fallbackCalls)
+	}
+	if gotApp != wantApp {
+		t.Errorf("downstream handler's AuthorizedAppFromContext = %v, want %v", gotApp, wantApp)
+	}
+}
+
+// TestCacheTokenTrust_PropagatesUser is the bearer-token-credentialed
+// counterpart of TestCacheTokenTrust_PropagatesAuthorizedApp, covering the
+// admin-console user-JWT path via WithUser/UserFromContext.
+func TestCacheTokenTrust_PropagatesUser(t *testing.T) {
+	t.Parallel()
+
+	cache := testTokenTrustCache(t, time.Minute)
+	wantUser := &database.User{}
+
+	fallbackCalls := 0
+	fallback := mux.MiddlewareFunc(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fallbackCalls++
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), wantUser)))
+		})
+	})
+
+	var gotUser *database.User
+	downstreamCalls := 0
+	downstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstreamCalls++
+		gotUser, _ = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := CacheTokenTrust(context.Background(), cache, fallback)(downstream)
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/api/verify", nil)
+		r.Header.Set("Authorization", "Bearer some-jwt")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+	}
+
+	if downstreamCalls != 2 {
+		t.Fatalf("downstream handler was called %d times, want 2", downstreamCalls)
+	}
+	if fallbackCalls != 1 {
+		t.Errorf("fallback was called %d times, want 1 (the second request should be served from cache)", fallbackCalls)
+	}
+	if gotUser != wantUser {
+		t.Errorf("downstream handler's UserFromContext = %v, want %v", gotUser, wantUser)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "well formed bearer token", header: "Bearer abc123", want: "abc123"},
+		{name: "missing header", header: "", want: ""},
+		{name: "wrong scheme", header: "Basic abc123", want: ""},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.header != "" {
+				r.Header.Set("Authorization", c.header)
+			}
+
+			if got := bearerToken(r); got != c.want {
+				t.Errorf("bearerToken() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing extracts an incoming trace context (B3 or W3C tracecontext,
+// whichever the configured propagator understands) and starts a server span
+// for the request, making it available to downstream handlers via the
+// request's context.Context. It should be installed before rateLimit so that
+// rate-limited requests are still visible in traces.
+func Tracing(ctx context.Context, serviceName string) mux.MiddlewareFunc {
+	propagator := otel.GetTextMapPropagator()
+	tracer := otel.Tracer(serviceName)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqCtx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			spanName := r.Method + " " + r.URL.Path
+			reqCtx, span := tracer.Start(reqCtx, spanName, trace.WithSpanKind(trace.SpanKindServer))
+			defer span.End()
+
+			next.ServeHTTP(w, r.WithContext(reqCtx))
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing_CallsNext(t *testing.T) {
+	t.Parallel()
+
+	called := false
+	var sawSpan trace.Span
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		sawSpan = trace.SpanFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mw := Tracing(context.Background(), "test-service")
+	handler := mw(next)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/verify", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if !called {
+		t.Fatal("Tracing() middleware did not call the wrapped handler")
+	}
+	if sawSpan == nil {
+		t.Error("downstream handler's context did not carry a span")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("response code = %d, want %d", w.Code, http.StatusOK)
+	}
+}
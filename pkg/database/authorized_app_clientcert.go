@@ -0,0 +1,29 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+// FindAuthorizedAppByClientCertSAN looks up the device AuthorizedApp within
+// realmID whose configured ClientCertSAN matches the SAN presented in a
+// validated client certificate. Used by middleware.RequireClientCert once the
+// certificate's issuing CA has identified the realm.
+func (db *Database) FindAuthorizedAppByClientCertSAN(realmID uint, san string) (*AuthorizedApp, error) {
+	var app AuthorizedApp
+	if err := db.db.
+		Where("realm_id = ? AND client_cert_san = ? AND api_key_type = ?", realmID, san, APIUserTypeDevice).
+		First(&app).Error; err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
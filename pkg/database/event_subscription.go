@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EventSubscription records a realm's registration for verification-code
+// lifecycle webhook callbacks.
+type EventSubscription struct {
+	gorm.Model
+	Errorable `gorm:"-"`
+
+	// UUID is the externally visible subscription identifier returned from
+	// the registration endpoint and used to unsubscribe.
+	UUID string `gorm:"column:uuid; type:uuid;"`
+
+	// RealmID is the realm that registered this subscription.
+	RealmID uint `gorm:"column:realm_id;"`
+
+	// CallbackURL is the HTTPS endpoint that receives the signed event
+	// payloads.
+	CallbackURL string `gorm:"column:callback_url;"`
+
+	// HMACSecret signs the JSON body of each callback so subscribers can
+	// verify the event originated from this server.
+	HMACSecret string `gorm:"column:hmac_secret;"`
+
+	// EventTypesRaw is a comma-separated list of the event types this
+	// subscription filters on. An empty value matches all event types.
+	EventTypesRaw string `gorm:"column:event_types;"`
+
+	// CodeUUID optionally scopes the subscription to a single verification
+	// code, used by the long-poll/SSE status stream.
+	CodeUUID string `gorm:"column:code_uuid;"`
+}
+
+// EventTypes splits EventTypesRaw into the filtered event type list.
+func (s *EventSubscription) EventTypes() []string {
+	if s.EventTypesRaw == "" {
+		return nil
+	}
+	return strings.Split(s.EventTypesRaw, ",")
+}
+
+// TableName sets the EventSubscription table name.
+func (EventSubscription) TableName() string {
+	return "event_subscriptions"
+}
+
+// BeforeSave runs validations for EventSubscription before it's saved.
+func (s *EventSubscription) BeforeSave(tx *gorm.DB) error {
+	if s.UUID == "" {
+		s.UUID = uuid.New().String()
+	}
+	if s.CallbackURL == "" {
+		s.AddError("callbackURL", "cannot be blank")
+	}
+	if s.RealmID == 0 {
+		s.AddError("realmID", "cannot be blank")
+	}
+	if len(s.ErrorsOf("callbackURL", "realmID")) > 0 {
+		return fmt.Errorf("validation failed: %s", strings.Join(s.ErrorMessages(), ", "))
+	}
+	return nil
+}
+
+// SaveEventSubscription creates or updates the given subscription.
+func (db *Database) SaveEventSubscription(s *EventSubscription) error {
+	if s.Model.ID == 0 {
+		return db.db.Create(s).Error
+	}
+	return db.db.Save(s).Error
+}
+
+// FindEventSubscriptionsByRealm returns the active subscriptions registered
+// for the given realm.
+func (db *Database) FindEventSubscriptionsByRealm(realmID uint) ([]*EventSubscription, error) {
+	var subs []*EventSubscription
+	if err := db.db.Where("realm_id = ?", realmID).Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// DeleteEventSubscription removes the subscription with the given UUID, as
+// long as it belongs to realmID.
+func (db *Database) DeleteEventSubscription(realmID uint, uuid string) error {
+	return db.db.
+		Where("realm_id = ? AND uuid = ?", realmID, uuid).
+		Delete(&EventSubscription{}).Error
+}
@@ -0,0 +1,40 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+)
+
+// eventSubscriptionsMigrations creates the event_subscriptions table
+// EventSubscription needs.
+//
+// This checkout doesn't include pkg/database/migrations.go, the file that
+// presumably owns the project's real, ordered gormigrate.Migration slice and
+// whatever ID-numbering scheme it follows, so this can't be appended to that
+// list here. Wiring this into the real migration chain is a prerequisite for
+// deploying webhook subscriptions against an actual database.
+func eventSubscriptionsMigrations() []*gormigrate.Migration {
+	return []*gormigrate.Migration{
+		{
+			ID: "20260730000001-CreateEventSubscriptions",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&EventSubscription{})
+			},
+		},
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// RealmTrustedCA is a realm-scoped root or intermediate CA certificate,
+// PEM-encoded, trusted to issue the client certificates device installs
+// present to middleware.RequireClientCert.
+type RealmTrustedCA struct {
+	gorm.Model
+	Errorable `gorm:"-"`
+
+	RealmID uint   `gorm:"column:realm_id;"`
+	PEM     string `gorm:"column:pem;"`
+}
+
+// TableName sets the RealmTrustedCA table name.
+func (RealmTrustedCA) TableName() string {
+	return "realm_trusted_cas"
+}
+
+// BeforeSave runs validations for RealmTrustedCA before it's saved.
+func (c *RealmTrustedCA) BeforeSave(tx *gorm.DB) error {
+	if c.PEM == "" {
+		c.AddError("pem", "cannot be blank")
+	}
+	if c.RealmID == 0 {
+		c.AddError("realmID", "cannot be blank")
+	}
+	if len(c.ErrorsOf("pem", "realmID")) > 0 {
+		return fmt.Errorf("validation failed: %s", strings.Join(c.ErrorMessages(), ", "))
+	}
+	return nil
+}
+
+// SaveRealmTrustedCA creates or updates the given trusted CA.
+func (db *Database) SaveRealmTrustedCA(c *RealmTrustedCA) error {
+	if c.Model.ID == 0 {
+		return db.db.Create(c).Error
+	}
+	return db.db.Save(c).Error
+}
+
+// FindTrustedCAsByRealm returns the trust bundle configured for the given
+// realm.
+func (db *Database) FindTrustedCAsByRealm(realmID uint) ([]*RealmTrustedCA, error) {
+	var cas []*RealmTrustedCA
+	if err := db.db.Where("realm_id = ?", realmID).Find(&cas).Error; err != nil {
+		return nil, err
+	}
+	return cas, nil
+}
+
+// FindAllTrustedCAs returns every realm's trust bundle, keyed by realm ID, so
+// middleware.RequireClientCert can find which realm issued a presented
+// certificate without already knowing the realm.
+func (db *Database) FindAllTrustedCAs() (map[uint][]*RealmTrustedCA, error) {
+	var cas []*RealmTrustedCA
+	if err := db.db.Find(&cas).Error; err != nil {
+		return nil, err
+	}
+
+	byRealm := make(map[uint][]*RealmTrustedCA)
+	for _, ca := range cas {
+		byRealm[ca.RealmID] = append(byRealm[ca.RealmID], ca)
+	}
+	return byRealm, nil
+}
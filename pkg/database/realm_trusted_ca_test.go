@@ -0,0 +1,63 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import "testing"
+
+func TestRealmTrustedCA_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		ca      *RealmTrustedCA
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			ca:      &RealmTrustedCA{RealmID: 1, PEM: "-----BEGIN CERTIFICATE-----\n...\n-----END CERTIFICATE-----"},
+			wantErr: false,
+		},
+		{
+			name:    "blank pem",
+			ca:      &RealmTrustedCA{RealmID: 1, PEM: ""},
+			wantErr: true,
+		},
+		{
+			name:    "zero realm id",
+			ca:      &RealmTrustedCA{RealmID: 0, PEM: "some-pem"},
+			wantErr: true,
+		},
+		{
+			name:    "blank pem and zero realm id",
+			ca:      &RealmTrustedCA{},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := c.ca.BeforeSave(nil)
+			if c.wantErr && err == nil {
+				t.Error("BeforeSave() = nil, want a validation error")
+			}
+			if !c.wantErr && err != nil {
+				t.Errorf("BeforeSave() = %v, want nil", err)
+			}
+		})
+	}
+}
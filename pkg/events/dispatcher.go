@@ -0,0 +1,177 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+)
+
+// SignatureHeader is the HTTP header carrying the HMAC-SHA256 signature of
+// the callback body, hex encoded.
+const SignatureHeader = "X-Verification-Server-Signature"
+
+// maxAttempts bounds the number of delivery attempts (the first try plus its
+// retries) made before a dispatch is given up on. Backoff is exponential, starting at retryBaseDelay.
+const maxAttempts = 5
+
+const retryBaseDelay = 2 * time.Second
+
+// Dispatcher fires signed webhook callbacks for subscribed realms when
+// verification-code lifecycle events occur.
+type Dispatcher struct {
+	db     *database.Database
+	client *http.Client
+}
+
+// NewDispatcher creates a Dispatcher that delivers events to the callbacks
+// registered in the event_subscriptions table.
+func NewDispatcher(db *database.Database) *Dispatcher {
+	return &Dispatcher{
+		db: db,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout: 10 * time.Second,
+					Control: safeDialControl,
+				}).DialContext,
+			},
+		},
+	}
+}
+
+// safeDialControl rejects dials to loopback, private, and other
+// reserved/internal addresses. Unlike eventsapi.validateCallbackURL (which
+// only checks the address a callback's hostname resolves to once, at
+// subscribe time), this runs on every single delivery attempt against the
+// actual address about to be dialed, so a callback host that's re-pointed at
+// an internal address after subscribing (DNS rebinding) is still refused.
+func safeDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid dial address %q: %w", address, err)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("dial address %q did not resolve to an IP", address)
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("refusing to dial reserved address %s", ip)
+	}
+
+	return nil
+}
+
+// Dispatch asynchronously delivers ev to every subscription whose filter it
+// matches. Delivery failures are retried with exponential backoff and
+// logged; they never block the caller.
+func (d *Dispatcher) Dispatch(ctx context.Context, ev *Event) {
+	logger := logging.FromContext(ctx).Named("events.Dispatch")
+
+	subs, err := d.db.FindEventSubscriptionsByRealm(ev.RealmID)
+	if err != nil {
+		logger.Errorw("failed to load event subscriptions", "error", err)
+		return
+	}
+
+	for _, sub := range subs {
+		if !ev.Matches(sub.RealmID, subscriptionEventTypes(sub), sub.CodeUUID) {
+			continue
+		}
+
+		go d.deliver(ctx, sub, ev)
+	}
+}
+
+// subscriptionEventTypes converts sub's stored event type strings to the
+// Type values Event.Matches compares against.
+func subscriptionEventTypes(sub *database.EventSubscription) []Type {
+	raw := sub.EventTypes()
+	if len(raw) == 0 {
+		return nil
+	}
+
+	types := make([]Type, len(raw))
+	for i, t := range raw {
+		types[i] = Type(t)
+	}
+	return types
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, sub *database.EventSubscription, ev *Event) {
+	logger := logging.FromContext(ctx).Named("events.deliver")
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		logger.Errorw("failed to marshal event", "error", err)
+		return
+	}
+
+	mac := hmac.New(sha256.New, []byte(sub.HMACSecret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	delay := retryBaseDelay
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err := d.post(ctx, sub.CallbackURL, signature, body); err != nil {
+			logger.Warnw("webhook delivery failed", "subscriptionID", sub.ID, "attempt", attempt, "error", err)
+			if attempt == maxAttempts {
+				logger.Errorw("webhook delivery permanently failed", "subscriptionID", sub.ID)
+				return
+			}
+			time.Sleep(delay)
+			delay *= 2
+			continue
+		}
+		return
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, url, signature string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signature)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook callback returned status %d", resp.StatusCode)
+	}
+	return nil
+}
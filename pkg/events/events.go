@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package events defines the verification-code lifecycle events that realms
+// may subscribe to and the dispatcher that delivers them to registered
+// webhook callbacks.
+package events
+
+import "time"
+
+// Type identifies a verification-code lifecycle transition.
+type Type string
+
+const (
+	// CodeIssued fires when a verification code is issued to a user.
+	CodeIssued Type = "code.issued"
+	// CodeClaimed fires when a verification code is exchanged for a
+	// verification token.
+	CodeClaimed Type = "code.claimed"
+	// CodeExpired fires when a verification code expires without being
+	// claimed.
+	CodeExpired Type = "code.expired"
+	// CertificateIssued fires when a verification token is exchanged for a
+	// signed diagnosis certificate.
+	CertificateIssued Type = "certificate.issued"
+)
+
+// Event is a single lifecycle occurrence for a verification code, delivered
+// to subscribers as the body of a webhook callback.
+type Event struct {
+	Type      Type      `json:"type"`
+	RealmID   uint      `json:"realmID"`
+	CodeUUID  string    `json:"codeUUID"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// New constructs an Event for the given realm and code, stamped with the
+// current time.
+func New(typ Type, realmID uint, codeUUID string) *Event {
+	return &Event{
+		Type:      typ,
+		RealmID:   realmID,
+		CodeUUID:  codeUUID,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// Matches reports whether the event satisfies the given subscription filter.
+func (e *Event) Matches(realmID uint, types []Type, codeUUID string) bool {
+	if e.RealmID != realmID {
+		return false
+	}
+	if codeUUID != "" && e.CodeUUID != codeUUID {
+		return false
+	}
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
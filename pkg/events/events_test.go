@@ -0,0 +1,49 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import "testing"
+
+func TestEvent_Matches(t *testing.T) {
+	t.Parallel()
+
+	base := New(CodeClaimed, 1, "code-uuid")
+
+	cases := []struct {
+		name     string
+		realmID  uint
+		types    []Type
+		codeUUID string
+		want     bool
+	}{
+		{name: "exact match", realmID: 1, types: []Type{CodeClaimed}, codeUUID: "code-uuid", want: true},
+		{name: "no type filter matches any type", realmID: 1, types: nil, codeUUID: "", want: true},
+		{name: "wrong realm", realmID: 2, types: nil, codeUUID: "", want: false},
+		{name: "wrong code uuid", realmID: 1, types: nil, codeUUID: "other-uuid", want: false},
+		{name: "type filter excludes event", realmID: 1, types: []Type{CodeExpired}, codeUUID: "", want: false},
+		{name: "type filter includes event among others", realmID: 1, types: []Type{CodeIssued, CodeClaimed}, codeUUID: "", want: true},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := base.Matches(c.realmID, c.types, c.codeUUID); got != c.want {
+				t.Errorf("Matches(%d, %v, %q) = %v, want %v", c.realmID, c.types, c.codeUUID, got, c.want)
+			}
+		})
+	}
+}